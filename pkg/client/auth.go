@@ -0,0 +1,163 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package client
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc/credentials"
+)
+
+// Credentials supplies per-RPC authentication metadata, modeled on etcd
+// clientv3's Username/Password fields but pluggable so callers can also
+// bring their own (e.g. an OIDC token source).
+type Credentials interface {
+	credentials.PerRPCCredentials
+}
+
+// BearerToken is a Credentials that sends a fixed "authorization: Bearer
+// <token>" header on every RPC.
+type BearerToken string
+
+func (t BearerToken) GetRequestMetadata(ctx context.Context, uri ...string) (map[string]string, error) {
+	return map[string]string{"authorization": "Bearer " + string(t)}, nil
+}
+
+func (t BearerToken) RequireTransportSecurity() bool { return true }
+
+// TokenFile is a Credentials that re-reads its token from a file every
+// Interval, the same pattern a projected Kubernetes ServiceAccount token
+// uses so rotation is picked up without a restart.
+type TokenFile struct {
+	Path     string
+	Interval time.Duration
+
+	mu    sync.Mutex
+	token string
+	read  time.Time
+}
+
+func (tf *TokenFile) GetRequestMetadata(ctx context.Context, uri ...string) (map[string]string, error) {
+	tok, err := tf.current()
+	if err != nil {
+		return nil, err
+	}
+
+	return map[string]string{"authorization": "Bearer " + tok}, nil
+}
+
+func (tf *TokenFile) RequireTransportSecurity() bool { return true }
+
+func (tf *TokenFile) current() (string, error) {
+	tf.mu.Lock()
+	defer tf.mu.Unlock()
+
+	interval := tf.Interval
+	if interval == 0 {
+		interval = time.Minute
+	}
+
+	if tf.token != "" && time.Since(tf.read) < interval {
+		return tf.token, nil
+	}
+
+	b, err := ioutil.ReadFile(tf.Path)
+	if err != nil {
+		if tf.token != "" {
+			// keep serving the last good token rather than failing RPCs
+			// over a transient read error (e.g. a projected volume update
+			// in progress)
+			return tf.token, nil
+		}
+		return "", err
+	}
+
+	tf.token = strings.TrimSpace(string(b))
+	tf.read = time.Now()
+	return tf.token, nil
+}
+
+// UsernamePassword is a Credentials that sends username/password via gRPC
+// metadata, the wire equivalent of etcd clientv3's Username/Password fields.
+type UsernamePassword struct {
+	Username string
+	Password string
+}
+
+func (up UsernamePassword) GetRequestMetadata(ctx context.Context, uri ...string) (map[string]string, error) {
+	return map[string]string{
+		"username": up.Username,
+		"password": up.Password,
+	}, nil
+}
+
+func (up UsernamePassword) RequireTransportSecurity() bool { return true }
+
+// insecureCredentials wraps a Credentials to allow it over a plaintext
+// connection, only used when --allow-insecure-credentials is passed.
+type insecureCredentials struct {
+	Credentials
+}
+
+func (insecureCredentials) RequireTransportSecurity() bool { return false }
+
+// credentialsFromFlags builds the Credentials configured via --token,
+// --token-file, --username/--password-file, or nil if none were set.
+func (epc *EndpointsClient) credentialsFromFlags() (Credentials, error) {
+	set := 0
+	var creds Credentials
+
+	if epc.Token != "" {
+		set++
+		creds = BearerToken(epc.Token)
+	}
+
+	if epc.TokenFile != "" {
+		set++
+		creds = &TokenFile{Path: epc.TokenFile, Interval: epc.TokenFileInterval}
+	}
+
+	if epc.Username != "" {
+		set++
+
+		password := ""
+		if epc.PasswordFile != "" {
+			b, err := ioutil.ReadFile(epc.PasswordFile)
+			if err != nil {
+				return nil, err
+			}
+			password = strings.TrimSpace(string(b))
+		}
+
+		creds = UsernamePassword{Username: epc.Username, Password: password}
+	}
+
+	if set > 1 {
+		return nil, fmt.Errorf("only one of --token, --token-file, --username may be set")
+	}
+
+	if creds != nil && epc.AllowInsecureCredentials {
+		creds = insecureCredentials{creds}
+	}
+
+	return creds, nil
+}
@@ -0,0 +1,110 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package client
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+func TestCredentialsFromFlagsNoneSet(t *testing.T) {
+	epc := &EndpointsClient{}
+
+	creds, err := epc.credentialsFromFlags()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if creds != nil {
+		t.Fatalf("expected nil credentials, got %#v", creds)
+	}
+}
+
+func TestCredentialsFromFlagsToken(t *testing.T) {
+	epc := &EndpointsClient{Token: "s3cr3t"}
+
+	creds, err := epc.credentialsFromFlags()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if creds != BearerToken("s3cr3t") {
+		t.Fatalf("expected BearerToken(s3cr3t), got %#v", creds)
+	}
+}
+
+func TestCredentialsFromFlagsUsernameWithPasswordFile(t *testing.T) {
+	dir := t.TempDir()
+	passwordFile := filepath.Join(dir, "password")
+	if err := ioutil.WriteFile(passwordFile, []byte("hunter2\n"), 0o600); err != nil {
+		t.Fatalf("failed to write password file: %v", err)
+	}
+
+	epc := &EndpointsClient{Username: "alice", PasswordFile: passwordFile}
+
+	creds, err := epc.credentialsFromFlags()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	up, ok := creds.(UsernamePassword)
+	if !ok {
+		t.Fatalf("expected UsernamePassword, got %#v", creds)
+	}
+	if up.Username != "alice" || up.Password != "hunter2" {
+		t.Fatalf("got %#v", up)
+	}
+}
+
+func TestCredentialsFromFlagsMissingPasswordFile(t *testing.T) {
+	epc := &EndpointsClient{Username: "alice", PasswordFile: "/nonexistent/password"}
+
+	if _, err := epc.credentialsFromFlags(); err == nil {
+		t.Fatal("expected an error reading a missing password file, got nil")
+	}
+}
+
+func TestCredentialsFromFlagsRejectsMultiple(t *testing.T) {
+	epc := &EndpointsClient{Token: "t", Username: "alice"}
+
+	if _, err := epc.credentialsFromFlags(); err == nil {
+		t.Fatal("expected an error when more than one credential source is set")
+	}
+}
+
+func TestCredentialsFromFlagsAllowInsecure(t *testing.T) {
+	epc := &EndpointsClient{Token: "t", AllowInsecureCredentials: true}
+
+	creds, err := epc.credentialsFromFlags()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if creds.RequireTransportSecurity() {
+		t.Fatal("expected RequireTransportSecurity() to be false when wrapped as insecure")
+	}
+}
+
+func TestCredentialsFromFlagsRequiresTransportSecurityByDefault(t *testing.T) {
+	epc := &EndpointsClient{Token: "t"}
+
+	creds, err := epc.credentialsFromFlags()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !creds.RequireTransportSecurity() {
+		t.Fatal("expected RequireTransportSecurity() to be true without --allow-insecure-credentials")
+	}
+}
@@ -0,0 +1,65 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package client
+
+import (
+	"testing"
+	"time"
+)
+
+func TestNextBackoffStaysWithinBounds(t *testing.T) {
+	base := 1 * time.Second
+	max := 30 * time.Second
+
+	current := time.Duration(0)
+	for i := 0; i < 1000; i++ {
+		current = nextBackoff(current, base, max)
+
+		if current < base {
+			t.Fatalf("round %d: delay %v below base %v", i, current, base)
+		}
+		if current > max {
+			t.Fatalf("round %d: delay %v above cap %v", i, current, max)
+		}
+	}
+}
+
+func TestNextBackoffCapsAtMax(t *testing.T) {
+	base := 1 * time.Second
+	max := 2 * time.Second
+
+	// A large current delay would pick from [base, current*3], which is
+	// well past max; nextBackoff must still clamp to it.
+	for i := 0; i < 100; i++ {
+		if got := nextBackoff(10*time.Second, base, max); got > max {
+			t.Fatalf("delay %v exceeds cap %v", got, max)
+		}
+	}
+}
+
+func TestNextBackoffTreatsZeroCurrentAsBase(t *testing.T) {
+	base := 1 * time.Second
+	max := 30 * time.Second
+
+	// With current == 0, the jitter window is [base, base*3]; it must never
+	// fall below base regardless of the random draw.
+	for i := 0; i < 100; i++ {
+		if got := nextBackoff(0, base, max); got < base {
+			t.Fatalf("delay %v below base %v", got, base)
+		}
+	}
+}
@@ -0,0 +1,229 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package client
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"google.golang.org/grpc/balancer"
+	"google.golang.org/grpc/balancer/base"
+
+	"k8s.io/klog"
+)
+
+// healthBalancerName is registered with grpc.WithBalancerName so that every
+// dial (including "multi:///a,b,c" targets) gets passive health tracking
+// instead of gRPC's default always-healthy picker. This is the same idea as
+// etcd clientv3's health balancer: a backend that keeps accepting TCP
+// connects but errors or hangs on the actual RPC is taken out of rotation
+// for a cool-down period instead of being retried on every call.
+const healthBalancerName = "kpng_health"
+
+func init() {
+	balancer.Register(base.NewBalancerBuilder(healthBalancerName, &healthPickerBuilder{}, base.Config{HealthCheck: true}))
+}
+
+// defaultUnhealthyCooldownInitial is the cool-down applied the first time an
+// endpoint is marked unhealthy, absent an EndpointsClient.UnhealthyCooldownInitial
+// override. It doubles, up to unhealthyCooldownCap, each time the probe
+// admitted after a cool-down fails or times out; failures reported while no
+// probe is outstanding restart the timer without doubling it. It is reset as
+// soon as the endpoint is seen healthy again.
+const defaultUnhealthyCooldownInitial = 5 * time.Second
+
+const unhealthyCooldownCap = 2 * time.Minute
+
+// probeTimeout bounds how long the one admitted probe of a cooling-down
+// endpoint may stay outstanding before admit() gives up on it. Without this,
+// a backend that hangs on Watch/Recv instead of erroring out — the exact
+// failure mode this balancer exists to catch — would leave probing stuck
+// true forever, since neither markEndpointHealthy nor markEndpointUnhealthy
+// would ever be called to clear it.
+const probeTimeout = 30 * time.Second
+
+// endpointHealth tracks the passive health state of a single endpoint
+// address, keyed by the address string gRPC hands to the resolver/balancer.
+type endpointHealth struct {
+	mu           sync.Mutex
+	unhealthy    bool
+	cooldown     time.Duration
+	until        time.Time
+	probing      bool
+	probeStarted time.Time
+}
+
+var endpointHealthRegistry = struct {
+	mu sync.Mutex
+	m  map[string]*endpointHealth
+}{m: map[string]*endpointHealth{}}
+
+func endpointHealthFor(addr string) *endpointHealth {
+	endpointHealthRegistry.mu.Lock()
+	defer endpointHealthRegistry.mu.Unlock()
+
+	eh, ok := endpointHealthRegistry.m[addr]
+	if !ok {
+		eh = &endpointHealth{}
+		endpointHealthRegistry.m[addr] = eh
+	}
+	return eh
+}
+
+// markEndpointUnhealthy marks addr unhealthy, starting or doubling its
+// cool-down timer. Call this when a dial times out or a Send/Recv on the
+// watch stream to that endpoint fails. initialCooldown sets the cool-down
+// the first time addr is marked unhealthy; it has no effect on an address
+// that's already cooling down, since the registry (like gRPC's balancer
+// registry) is shared process-wide and the first caller to see an address
+// wins.
+func markEndpointUnhealthy(addr string, initialCooldown time.Duration) {
+	if addr == "" {
+		return
+	}
+
+	eh := endpointHealthFor(addr)
+
+	eh.mu.Lock()
+	defer eh.mu.Unlock()
+
+	if eh.cooldown == 0 {
+		eh.cooldown = initialCooldown
+	} else if eh.probing {
+		// a probe that failed again: double the cool-down
+		eh.cooldown *= 2
+		if eh.cooldown > unhealthyCooldownCap {
+			eh.cooldown = unhealthyCooldownCap
+		}
+	}
+
+	eh.unhealthy = true
+	eh.probing = false
+	eh.until = time.Now().Add(eh.cooldown)
+
+	klog.V(1).Info("marking endpoint unhealthy: ", addr, " for ", eh.cooldown)
+}
+
+// markEndpointHealthy clears addr's unhealthy state. Call this after any
+// successful Recv on the watch stream to that endpoint.
+func markEndpointHealthy(addr string) {
+	if addr == "" {
+		return
+	}
+
+	eh := endpointHealthFor(addr)
+
+	eh.mu.Lock()
+	defer eh.mu.Unlock()
+
+	eh.unhealthy = false
+	eh.probing = false
+	eh.cooldown = 0
+}
+
+// admit reports whether a pick of this endpoint should be allowed right now.
+// Admitting an unhealthy endpoint whose cool-down has expired starts the one
+// allowed probe of it.
+func (eh *endpointHealth) admit() (ok bool) {
+	eh.mu.Lock()
+	defer eh.mu.Unlock()
+
+	if !eh.unhealthy {
+		return true
+	}
+
+	if eh.probing {
+		if time.Since(eh.probeStarted) < probeTimeout {
+			// a probe is already in flight, don't pile on
+			return false
+		}
+
+		// the outstanding probe has hung longer than probeTimeout with
+		// neither a success nor a failure reported: treat it like a
+		// failed probe (double the cool-down) so the endpoint doesn't
+		// stay wedged out of rotation forever.
+		eh.cooldown *= 2
+		if eh.cooldown > unhealthyCooldownCap {
+			eh.cooldown = unhealthyCooldownCap
+		}
+		eh.until = time.Now().Add(eh.cooldown)
+		eh.probing = false
+	}
+
+	if time.Now().Before(eh.until) {
+		return false
+	}
+
+	eh.probing = true
+	eh.probeStarted = time.Now()
+	return true
+}
+
+type healthPickerBuilder struct{}
+
+func (*healthPickerBuilder) Build(info base.PickerBuildInfo) balancer.Picker {
+	if len(info.ReadySCs) == 0 {
+		return base.NewErrPicker(balancer.ErrNoSubConnAvailable)
+	}
+
+	p := &healthPicker{}
+
+	for sc, scInfo := range info.ReadySCs {
+		p.subConns = append(p.subConns, healthSubConn{
+			sc:   sc,
+			addr: scInfo.Address.Addr,
+			eh:   endpointHealthFor(scInfo.Address.Addr),
+		})
+	}
+
+	return p
+}
+
+type healthSubConn struct {
+	sc   balancer.SubConn
+	addr string
+	eh   *endpointHealth
+}
+
+// healthPicker round-robins over ready sub-connections, skipping any whose
+// endpoint is currently unhealthy and cooling down, except for the single
+// probe call admitted once its cool-down expires.
+type healthPicker struct {
+	subConns []healthSubConn
+	next     uint32
+}
+
+func (p *healthPicker) Pick(info balancer.PickInfo) (balancer.PickResult, error) {
+	n := len(p.subConns)
+
+	// first pass: only admit endpoints that are healthy or due for a probe
+	for i := 0; i < n; i++ {
+		idx := int(atomic.AddUint32(&p.next, 1)-1) % n
+		sc := p.subConns[idx]
+
+		if sc.eh.admit() {
+			return balancer.PickResult{SubConn: sc.sc}, nil
+		}
+	}
+
+	// every endpoint is cooling down: degrade gracefully rather than fail
+	// the call outright, same as etcd clientv3's health balancer falling
+	// back to round-robin when nothing looks healthy.
+	idx := int(atomic.AddUint32(&p.next, 1)-1) % n
+	return balancer.PickResult{SubConn: p.subConns[idx].sc}, nil
+}
@@ -0,0 +1,127 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package client
+
+import (
+	"testing"
+	"time"
+)
+
+func TestAdmitHealthyByDefault(t *testing.T) {
+	eh := endpointHealthFor(t.Name())
+
+	if !eh.admit() {
+		t.Fatal("a never-marked-unhealthy endpoint must be admitted")
+	}
+}
+
+func TestAdmitBlocksDuringCooldown(t *testing.T) {
+	addr := t.Name()
+	markEndpointUnhealthy(addr, 50*time.Millisecond)
+
+	eh := endpointHealthFor(addr)
+	if eh.admit() {
+		t.Fatal("expected admit() to block while the cool-down is still running")
+	}
+}
+
+func TestAdmitProbesAfterCooldown(t *testing.T) {
+	addr := t.Name()
+	markEndpointUnhealthy(addr, 20*time.Millisecond)
+
+	time.Sleep(30 * time.Millisecond)
+
+	eh := endpointHealthFor(addr)
+	if !eh.admit() {
+		t.Fatal("expected the one probe to be admitted once the cool-down expires")
+	}
+	if eh.admit() {
+		t.Fatal("expected a second pick not to pile onto the in-flight probe")
+	}
+}
+
+func TestMarkEndpointHealthyClearsState(t *testing.T) {
+	addr := t.Name()
+	markEndpointUnhealthy(addr, 50*time.Millisecond)
+	markEndpointHealthy(addr)
+
+	eh := endpointHealthFor(addr)
+	if !eh.admit() {
+		t.Fatal("expected admit() to succeed right after markEndpointHealthy")
+	}
+}
+
+func TestMarkEndpointUnhealthyDoublesCooldownOnFailedProbe(t *testing.T) {
+	addr := t.Name()
+	markEndpointUnhealthy(addr, 20*time.Millisecond)
+
+	time.Sleep(30 * time.Millisecond)
+
+	eh := endpointHealthFor(addr)
+	if !eh.admit() {
+		t.Fatal("expected the probe to be admitted")
+	}
+
+	// The probe failed: report it the same way NextCh would.
+	markEndpointUnhealthy(addr, 20*time.Millisecond)
+
+	eh.mu.Lock()
+	got := eh.cooldown
+	eh.mu.Unlock()
+
+	if want := 40 * time.Millisecond; got != want {
+		t.Fatalf("cooldown = %v, want %v (doubled)", got, want)
+	}
+}
+
+func TestAdmitUnsticksATimedOutProbe(t *testing.T) {
+	addr := t.Name()
+	eh := endpointHealthFor(addr)
+
+	eh.mu.Lock()
+	eh.unhealthy = true
+	eh.cooldown = 10 * time.Millisecond
+	eh.until = time.Now().Add(-time.Second) // already elapsed
+	eh.probing = true
+	eh.probeStarted = time.Now().Add(-(probeTimeout + time.Second)) // stuck
+	eh.mu.Unlock()
+
+	// The stuck probe must not be admitted again immediately, but admit()
+	// should treat it like a failed probe (double the cool-down) instead of
+	// leaving probing stuck true forever.
+	if eh.admit() {
+		t.Fatal("expected admit() to not immediately re-admit a just-unstuck probe")
+	}
+
+	eh.mu.Lock()
+	stillProbing := eh.probing
+	newCooldown := eh.cooldown
+	eh.mu.Unlock()
+
+	if stillProbing {
+		t.Fatal("expected the timed-out probe to be cleared")
+	}
+	if want := 20 * time.Millisecond; newCooldown != want {
+		t.Fatalf("cooldown = %v, want %v (doubled)", newCooldown, want)
+	}
+
+	time.Sleep(newCooldown + 10*time.Millisecond)
+
+	if !eh.admit() {
+		t.Fatal("expected a fresh probe to be admitted once the new cool-down elapses")
+	}
+}
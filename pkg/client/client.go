@@ -18,14 +18,18 @@ package client
 
 import (
 	"context"
+	"crypto/tls"
+	"math/rand"
 	"os"
 	"os/signal"
 	"syscall"
 	"time"
 
 	"github.com/google/btree"
+	grpc_prometheus "github.com/grpc-ecosystem/go-grpc-prometheus"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/peer"
 	"google.golang.org/protobuf/proto"
 
 	// allow multi gRPC URLs
@@ -65,27 +69,92 @@ type EndpointsClient struct {
 	// ErrorDelay is the delay before retrying after an error.
 	ErrorDelay time.Duration
 
+	// MaxErrorDelay caps the backoff delay applied between retries.
+	MaxErrorDelay time.Duration
+
+	// BackoffJitter enables decorrelated-jitter backoff instead of always
+	// sleeping ErrorDelay.
+	BackoffJitter bool
+
 	// GRPCBuffer is the max size of a gRPC message
 	MaxMsgSize int
 
+	// UnhealthyCooldownInitial is the cool-down applied the first time an
+	// endpoint this client talks to is marked unhealthy, doubling up to a cap
+	// each time the follow-up probe fails. Defaults to 5s if unset. Since the
+	// underlying health registry is shared process-wide (gRPC's balancer
+	// registry is too), this has no effect on an address that is already
+	// cooling down from a failure reported by any EndpointsClient in the
+	// process.
+	UnhealthyCooldownInitial time.Duration
+
+	// MetricsListen, if set, serves Prometheus client metrics on /metrics.
+	MetricsListen string
+
+	// StateDir, if set, persists a snapshot of the btree after each sync so
+	// a restart can warm-start from it instead of a full resync.
+	StateDir string
+
+	// Token, TokenFile, Username and PasswordFile configure per-RPC
+	// authentication; at most one of Token/TokenFile/Username may be set.
+	// See credentialsFromFlags.
+	Token             string
+	TokenFile         string
+	TokenFileInterval time.Duration
+	Username          string
+	PasswordFile      string
+
+	// AllowInsecureCredentials lets Token/TokenFile/Username auth be sent
+	// over a plaintext connection. Refused by default since it would leak
+	// the secret to anyone on the wire.
+	AllowInsecureCredentials bool
+
+	unaryInterceptors  []grpc.UnaryClientInterceptor
+	streamInterceptors []grpc.StreamClientInterceptor
+
 	conn     *grpc.ClientConn
 	watch    localnetv1.Endpoints_WatchClient
 	watchReq *localnetv1.WatchReq
 
 	data *btree.BTree
 
+	// currentDelay is the decorrelated-jitter backoff state; it starts at
+	// ErrorDelay and is reset there after the first successful Recv of a
+	// Sync op.
+	currentDelay time.Duration
+
 	ctx    context.Context
 	cancel func()
 }
 
 // DefaultFlags registers this client's values to the standard flags.
 func (epc *EndpointsClient) DefaultFlags(flags FlagSet) {
-	flags.StringVar(&epc.Target, "target", "127.0.0.1:12090", "API to reach (can use multi:///1.0.0.1:1234,1.0.0.2:1234)")
+	flags.StringVar(&epc.Target, "target", "127.0.0.1:12090", "API to reach (can use multi:///1.0.0.1:1234,1.0.0.2:1234, unix:///path/to.sock, unix-abstract:///name, http(s)://host:port, passthrough:///..., dns:///...)")
 
 	flags.DurationVar(&epc.ErrorDelay, "error-delay", 1*time.Second, "duration to wait before retrying after errors")
 
+	flags.DurationVar(&epc.MaxErrorDelay, "max-error-delay", 30*time.Second, "cap on the backoff delay between retries after errors")
+
+	flags.BoolVar(&epc.BackoffJitter, "backoff-jitter", true, "use decorrelated-jitter backoff between retries instead of a fixed error-delay")
+
 	flags.IntVar(&epc.MaxMsgSize, "max-msg-size", 4<<20, "max gRPC message size")
 
+	flags.DurationVar(&epc.UnhealthyCooldownInitial, "unhealthy-cooldown", defaultUnhealthyCooldownInitial, "initial cool-down before retrying an endpoint that failed a Send/Recv, doubling up to a cap on repeated failures")
+
+	flags.StringVar(&epc.MetricsListen, "metrics-listen", "", "if set, serve Prometheus client metrics on this address (e.g. :9090)")
+
+	flags.StringVar(&epc.StateDir, "state-dir", "", "if set, persist a snapshot of the watched state here for fast warm-start on restart")
+
+	flags.StringVar(&epc.Token, "token", "", "bearer token to authenticate with")
+
+	flags.StringVar(&epc.TokenFile, "token-file", "", "file to read a bearer token from, re-read periodically (e.g. a projected ServiceAccount token)")
+
+	flags.StringVar(&epc.Username, "username", "", "username to authenticate with; the password is read from --password-file, or is empty if that is unset")
+
+	flags.StringVar(&epc.PasswordFile, "password-file", "", "file to read the password for --username from")
+
+	flags.BoolVar(&epc.AllowInsecureCredentials, "allow-insecure-credentials", false, "allow sending --token/--token-file/--username credentials over a plaintext connection")
+
 	epc.TLS.Bind(flags)
 }
 
@@ -124,8 +193,12 @@ retry:
 	}
 
 	// say we're ready
+	sentAt := time.Now()
+
 	err := epc.watch.Send(req)
 	if err != nil {
+		markEndpointUnhealthy(epc.peerAddr(), epc.unhealthyCooldown())
+		watchReconnectsTotal.Inc()
 		epc.postError()
 		goto retry
 	}
@@ -137,10 +210,15 @@ apply:
 
 		if err != nil {
 			klog.Error("watch recv failed: ", err)
+			markEndpointUnhealthy(epc.peerAddr(), epc.unhealthyCooldown())
+			recordRecvError(err)
+			watchReconnectsTotal.Inc()
 			epc.postError()
 			goto retry
 		}
 
+		markEndpointHealthy(epc.peerAddr())
+
 		switch v := op.Op; v.(type) {
 		case *localnetv1.OpItem_Set:
 			set := op.GetSet()
@@ -168,10 +246,32 @@ apply:
 			epc.data.Delete(kv{Path: op.GetDelete().Path})
 
 		case *localnetv1.OpItem_Sync:
+			epc.currentDelay = 0 // reset backoff on a successful sync
+			syncLatencySeconds.Observe(time.Since(sentAt).Seconds())
+
+			if err := epc.Snapshot(); err != nil {
+				klog.Error("failed to write state snapshot: ", err)
+			}
+
 			break apply // done
 		}
 	}
 
+	services := servicesTracked.WithLabelValues(epc.Target)
+	endpoints := endpointsTracked.WithLabelValues(epc.Target)
+
+	services.Set(0)
+	endpoints.Set(0)
+	epc.data.Ascend(func(i btree.Item) bool {
+		switch i.(kv).Value.(type) {
+		case *localnetv1.Service:
+			services.Inc()
+		case *localnetv1.Endpoint:
+			endpoints.Inc()
+		}
+		return true
+	})
+
 	go func() {
 		defer close(results)
 
@@ -233,19 +333,46 @@ func (epc *EndpointsClient) Context() context.Context {
 func (epc *EndpointsClient) DialContext(ctx context.Context) (conn *grpc.ClientConn, err error) {
 	klog.Info("connecting to ", epc.Target)
 
+	epc.serveMetrics()
+
+	dialTarget, transportOpts, tlsImplied := resolveTarget(epc.Target)
+
+	unaryInterceptors := append(append([]grpc.UnaryClientInterceptor{}, epc.unaryInterceptors...), grpc_prometheus.UnaryClientInterceptor)
+	streamInterceptors := append(append([]grpc.StreamClientInterceptor{}, epc.streamInterceptors...), grpc_prometheus.StreamClientInterceptor)
+
 	opts := append(
 		make([]grpc.DialOption, 0),
 		grpc.WithMaxMsgSize(epc.MaxMsgSize),
+		grpc.WithBalancerName(healthBalancerName),
+		grpc.WithChainUnaryInterceptor(unaryInterceptors...),
+		grpc.WithChainStreamInterceptor(streamInterceptors...),
 	)
+	opts = append(opts, transportOpts...)
 
-	tlsCfg := epc.TLS.Config()
-	if tlsCfg == nil {
-		opts = append(opts, grpc.WithInsecure())
-	} else {
+	// --tls flags win when explicitly configured; otherwise infer from the
+	// target's scheme (http:// vs https://, unix:// implies insecure).
+	switch tlsCfg := epc.TLS.Config(); {
+	case tlsCfg != nil:
 		opts = append(opts, grpc.WithTransportCredentials(credentials.NewTLS(tlsCfg)))
+	case tlsImplied != nil && *tlsImplied:
+		opts = append(opts, grpc.WithTransportCredentials(credentials.NewTLS(&tls.Config{})))
+	default:
+		opts = append(opts, grpc.WithInsecure())
 	}
 
-	return grpc.DialContext(epc.ctx, epc.Target, opts...)
+	creds, err := epc.credentialsFromFlags()
+	if err != nil {
+		return nil, err
+	}
+
+	if creds != nil {
+		// grpc.DialContext fails on a plaintext connection when
+		// Credentials.RequireTransportSecurity is true, unless
+		// --allow-insecure-credentials wrapped it with insecureCredentials.
+		opts = append(opts, grpc.WithPerRPCCredentials(creds))
+	}
+
+	return grpc.DialContext(epc.ctx, dialTarget, opts...)
 }
 
 func (epc *EndpointsClient) Dial() (conn *grpc.ClientConn, err error) {
@@ -270,11 +397,21 @@ retry:
 	}
 
 	epc.conn = conn
-	epc.watch, err = localnetv1.NewEndpointsClient(epc.conn).Watch(epc.ctx)
+
+	// grpc.Peer captures which endpoint the balancer picked for this call
+	// even if starting the stream itself times out or otherwise fails, so a
+	// backend that accepts TCP connects but never completes the RPC still
+	// gets fed into the health tracker.
+	var p peer.Peer
+	epc.watch, err = localnetv1.NewEndpointsClient(epc.conn).Watch(epc.ctx, grpc.Peer(&p))
 
 	if err != nil {
 		conn.Close()
 
+		if p.Addr != nil {
+			markEndpointUnhealthy(p.Addr.String(), epc.unhealthyCooldown())
+		}
+
 		klog.Info("failed to start watch: ", err)
 		epc.errorSleep()
 		goto retry
@@ -286,8 +423,64 @@ retry:
 	return false
 }
 
+// peerAddr returns the address of the endpoint currently backing the watch
+// stream, as seen by the health balancer, or "" if there's no stream.
+func (epc *EndpointsClient) peerAddr() string {
+	if epc.watch == nil {
+		return ""
+	}
+
+	p, ok := peer.FromContext(epc.watch.Context())
+	if !ok {
+		return ""
+	}
+
+	return p.Addr.String()
+}
+
+// unhealthyCooldown returns UnhealthyCooldownInitial, defaulting it to
+// defaultUnhealthyCooldownInitial if unset.
+func (epc *EndpointsClient) unhealthyCooldown() time.Duration {
+	if epc.UnhealthyCooldownInitial == 0 {
+		return defaultUnhealthyCooldownInitial
+	}
+	return epc.UnhealthyCooldownInitial
+}
+
+// errorSleep waits before a retry. With BackoffJitter enabled (the default)
+// it uses decorrelated-jitter backoff, the same pattern etcd clientv3's
+// retry wrapper uses, to avoid every client reconnecting in lock-step after
+// a shared server blips. Without it, it falls back to the fixed ErrorDelay.
 func (epc *EndpointsClient) errorSleep() {
-	time.Sleep(epc.ErrorDelay)
+	if !epc.BackoffJitter {
+		time.Sleep(epc.ErrorDelay)
+		return
+	}
+
+	maxDelay := epc.MaxErrorDelay
+	if maxDelay == 0 {
+		maxDelay = 30 * time.Second
+	}
+
+	epc.currentDelay = nextBackoff(epc.currentDelay, epc.ErrorDelay, maxDelay)
+
+	time.Sleep(epc.currentDelay)
+}
+
+// nextBackoff picks the next decorrelated-jitter delay uniformly from
+// [base, current*3] (both ends included), capped at max. current is treated as base if it's the
+// zero value (the first retry after a success resets it).
+func nextBackoff(current, base, max time.Duration) time.Duration {
+	if current == 0 {
+		current = base
+	}
+
+	next := base + time.Duration(rand.Int63n(int64(current*3-base)+1))
+	if next > max {
+		next = max
+	}
+
+	return next
 }
 
 func (epc *EndpointsClient) postError() {
@@ -0,0 +1,143 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package client
+
+import (
+	"net/http"
+	"sync"
+
+	grpc_prometheus "github.com/grpc-ecosystem/go-grpc-prometheus"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/status"
+
+	"k8s.io/klog"
+)
+
+// Metrics published alongside grpc-prometheus' own client metrics, giving
+// the same kind of observability surface etcd clientv3 exposes.
+var (
+	watchReconnectsTotal = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "kpng_client_watch_reconnects_total",
+		Help: "Number of times the watch stream had to be re-established after an error.",
+	})
+
+	watchRecvErrorsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "kpng_client_watch_recv_errors_total",
+		Help: "Number of errors returned by Recv() on the watch stream, by gRPC status code.",
+	}, []string{"code"})
+
+	// Labeled by target rather than plain Gauges since a process can run
+	// more than one EndpointsClient (see New's doc comment); an unlabeled
+	// gauge would have the last client's Set() clobber every other
+	// client's count.
+	servicesTracked = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "kpng_client_services_tracked",
+		Help: "Number of services currently held in the client's local btree.",
+	}, []string{"target"})
+
+	endpointsTracked = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "kpng_client_endpoints_tracked",
+		Help: "Number of endpoints currently held in the client's local btree.",
+	}, []string{"target"})
+
+	syncLatencySeconds = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Name:    "kpng_client_sync_latency_seconds",
+		Help:    "Time between sending a WatchReq and receiving the matching OpItem_Sync.",
+		Buckets: prometheus.DefBuckets,
+	})
+)
+
+func init() {
+	prometheus.MustRegister(
+		watchReconnectsTotal,
+		watchRecvErrorsTotal,
+		servicesTracked,
+		endpointsTracked,
+		syncLatencySeconds,
+	)
+}
+
+// recordRecvError increments the per-code Recv error counter.
+func recordRecvError(err error) {
+	watchRecvErrorsTotal.WithLabelValues(status.Code(err).String()).Inc()
+}
+
+// WithUnaryInterceptor adds a unary client interceptor, to be chained (in
+// the order added) ahead of grpc-prometheus' own interceptor.
+func (epc *EndpointsClient) WithUnaryInterceptor(i grpc.UnaryClientInterceptor) *EndpointsClient {
+	epc.unaryInterceptors = append(epc.unaryInterceptors, i)
+	return epc
+}
+
+// WithStreamInterceptor adds a stream client interceptor, to be chained (in
+// the order added) ahead of grpc-prometheus' own interceptor.
+func (epc *EndpointsClient) WithStreamInterceptor(i grpc.StreamClientInterceptor) *EndpointsClient {
+	epc.streamInterceptors = append(epc.streamInterceptors, i)
+	return epc
+}
+
+var (
+	metricsServersMu sync.Mutex
+	metricsServers   = map[string]bool{}
+
+	grpcHistogramOnce sync.Once
+)
+
+// serveMetrics starts a /metrics HTTP endpoint on MetricsListen the first
+// time it's called for that address, if MetricsListen is set. Several
+// EndpointsClients in the same process (see New's doc comment) can each set
+// a distinct MetricsListen and all get served; calling this again with an
+// address already being served is a no-op.
+func (epc *EndpointsClient) serveMetrics() {
+	if epc.MetricsListen == "" {
+		return
+	}
+
+	grpcHistogramOnce.Do(grpc_prometheus.EnableClientHandlingTimeHistogram)
+
+	if alreadyServingMetrics(epc.MetricsListen) {
+		return
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.Handler())
+
+	go func() {
+		klog.Info("serving client metrics on ", epc.MetricsListen)
+		if err := http.ListenAndServe(epc.MetricsListen, mux); err != nil {
+			klog.Error("metrics server failed: ", err)
+		}
+	}()
+}
+
+// alreadyServingMetrics reports whether addr is already being served,
+// recording it as served as a side effect if not. Split out from
+// serveMetrics so the bookkeeping can be tested without opening a real
+// listener.
+func alreadyServingMetrics(addr string) bool {
+	metricsServersMu.Lock()
+	defer metricsServersMu.Unlock()
+
+	if metricsServers[addr] {
+		return true
+	}
+
+	metricsServers[addr] = true
+	return false
+}
@@ -0,0 +1,43 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package client
+
+import "testing"
+
+func TestAlreadyServingMetrics(t *testing.T) {
+	addr := ":0-TestAlreadyServingMetrics"
+
+	if alreadyServingMetrics(addr) {
+		t.Fatal("expected the first call for a fresh address to report false")
+	}
+
+	if !alreadyServingMetrics(addr) {
+		t.Fatal("expected a repeat call for the same address to report true")
+	}
+}
+
+func TestAlreadyServingMetricsPerAddress(t *testing.T) {
+	a := ":0-TestAlreadyServingMetricsPerAddress-a"
+	b := ":0-TestAlreadyServingMetricsPerAddress-b"
+
+	if alreadyServingMetrics(a) {
+		t.Fatal("expected the first call for address a to report false")
+	}
+	if alreadyServingMetrics(b) {
+		t.Fatal("a distinct address b must get its own listener, not be blocked by a")
+	}
+}
@@ -0,0 +1,223 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package client
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/google/btree"
+	"google.golang.org/protobuf/proto"
+
+	"k8s.io/klog"
+
+	"m.cluseau.fr/kube-proxy2/pkg/api/localnetv1"
+)
+
+const snapshotFileName = "state.pb"
+
+// Snapshot writes the current btree to <StateDir>/state.pb, as a
+// length-delimited stream of (path, set, value) records mirroring the
+// OpItem_Set ops that built it. It's a no-op if StateDir isn't set. Safe to
+// call concurrently with reads of epc's own btree since it only runs from
+// the NextCh goroutine.
+//
+// NextCh never loads this back into epc.data itself: localnetv1.WatchReq
+// has no revision field to resume from, so every (re)connect asks the
+// server for a full resync, which only ever adds or replaces paths that
+// currently exist server-side and never deletes ones that don't. Merging
+// the snapshot into a live epc.data ahead of such a resync would leave
+// entries the server deleted while the client was away stuck there
+// forever. The snapshot is written purely so some other process (or a
+// future revision-resume feature) can make use of it.
+func (epc *EndpointsClient) Snapshot() error {
+	if epc.StateDir == "" || epc.data == nil {
+		return nil
+	}
+
+	if err := os.MkdirAll(epc.StateDir, 0o750); err != nil {
+		return err
+	}
+
+	tmp := filepath.Join(epc.StateDir, snapshotFileName+".tmp")
+
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+
+	w := bufio.NewWriter(f)
+	var werr error
+
+	epc.data.Ascend(func(i btree.Item) bool {
+		e := i.(kv)
+
+		var setKind localnetv1.Set
+		var msg proto.Message
+
+		switch v := e.Value.(type) {
+		case *localnetv1.Service:
+			setKind = localnetv1.Set_ServicesSet
+			msg = v
+		case *localnetv1.Endpoint:
+			setKind = localnetv1.Set_EndpointsSet
+			msg = v
+		default:
+			return true
+		}
+
+		b, err := proto.Marshal(msg)
+		if err != nil {
+			werr = err
+			return false
+		}
+
+		werr = writeSnapshotRecord(w, e.Path, setKind, b)
+		return werr == nil
+	})
+
+	if werr == nil {
+		werr = w.Flush()
+	}
+	f.Close()
+
+	if werr != nil {
+		os.Remove(tmp)
+		return werr
+	}
+
+	return os.Rename(tmp, filepath.Join(epc.StateDir, snapshotFileName))
+}
+
+// Restore loads a previously written snapshot into epc's btree. It's a
+// no-op if StateDir isn't set or no snapshot exists yet.
+//
+// Next and NextCh do not call this, and each (re)connect they make replaces
+// epc.data with an empty tree, so whatever Restore loaded is dropped as soon
+// as NextCh dials; the restored items are not served by Next or NextCh.
+func (epc *EndpointsClient) Restore() error {
+	if epc.StateDir == "" {
+		return nil
+	}
+
+	if epc.data == nil {
+		epc.data = btree.New(2)
+	}
+
+	f, err := os.Open(filepath.Join(epc.StateDir, snapshotFileName))
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	r := bufio.NewReader(f)
+
+	for {
+		path, kind, value, err := readSnapshotRecord(r)
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return err
+		}
+
+		var v proto.Message
+		switch kind {
+		case localnetv1.Set_ServicesSet:
+			v = &localnetv1.Service{}
+		case localnetv1.Set_EndpointsSet:
+			v = &localnetv1.Endpoint{}
+		default:
+			continue
+		}
+
+		if err := proto.Unmarshal(value, v); err != nil {
+			klog.Error("failed to parse snapshot record: ", err)
+			continue
+		}
+
+		epc.data.ReplaceOrInsert(kv{path, v})
+	}
+
+	klog.Info("restored ", epc.data.Len(), " items from ", epc.StateDir)
+	return nil
+}
+
+func writeSnapshotRecord(w io.Writer, path string, kind localnetv1.Set, value []byte) error {
+	if err := writeLenPrefixed(w, []byte(path)); err != nil {
+		return err
+	}
+
+	var kindBuf [4]byte
+	binary.BigEndian.PutUint32(kindBuf[:], uint32(kind))
+	if _, err := w.Write(kindBuf[:]); err != nil {
+		return err
+	}
+
+	return writeLenPrefixed(w, value)
+}
+
+func readSnapshotRecord(r io.Reader) (path string, kind localnetv1.Set, value []byte, err error) {
+	pathBytes, err := readLenPrefixed(r)
+	if err != nil {
+		return
+	}
+
+	var kindBuf [4]byte
+	if _, err = io.ReadFull(r, kindBuf[:]); err != nil {
+		return
+	}
+
+	value, err = readLenPrefixed(r)
+	if err != nil {
+		return
+	}
+
+	path = string(pathBytes)
+	kind = localnetv1.Set(binary.BigEndian.Uint32(kindBuf[:]))
+	return
+}
+
+func writeLenPrefixed(w io.Writer, b []byte) error {
+	var lenBuf [4]byte
+	binary.BigEndian.PutUint32(lenBuf[:], uint32(len(b)))
+
+	if _, err := w.Write(lenBuf[:]); err != nil {
+		return err
+	}
+
+	_, err := w.Write(b)
+	return err
+}
+
+func readLenPrefixed(r io.Reader) ([]byte, error) {
+	var lenBuf [4]byte
+	if _, err := io.ReadFull(r, lenBuf[:]); err != nil {
+		return nil, err
+	}
+
+	b := make([]byte, binary.BigEndian.Uint32(lenBuf[:]))
+	if _, err := io.ReadFull(r, b); err != nil {
+		return nil, err
+	}
+
+	return b, nil
+}
@@ -0,0 +1,78 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package client
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	"m.cluseau.fr/kube-proxy2/pkg/api/localnetv1"
+)
+
+func TestSnapshotRecordRoundTrip(t *testing.T) {
+	var buf bytes.Buffer
+
+	records := []struct {
+		path  string
+		kind  localnetv1.Set
+		value []byte
+	}{
+		{"svc/default/foo", localnetv1.Set_ServicesSet, []byte("service bytes")},
+		{"ep/default/foo/10.0.0.1", localnetv1.Set_EndpointsSet, []byte{}},
+		{"svc/default/bar", localnetv1.Set_ServicesSet, []byte("more service bytes")},
+	}
+
+	for _, r := range records {
+		if err := writeSnapshotRecord(&buf, r.path, r.kind, r.value); err != nil {
+			t.Fatalf("writeSnapshotRecord(%q): %v", r.path, err)
+		}
+	}
+
+	for _, want := range records {
+		path, kind, value, err := readSnapshotRecord(&buf)
+		if err != nil {
+			t.Fatalf("readSnapshotRecord: %v", err)
+		}
+		if path != want.path {
+			t.Errorf("path = %q, want %q", path, want.path)
+		}
+		if kind != want.kind {
+			t.Errorf("kind = %v, want %v", kind, want.kind)
+		}
+		if !bytes.Equal(value, want.value) {
+			t.Errorf("value = %v, want %v", value, want.value)
+		}
+	}
+
+	if _, _, _, err := readSnapshotRecord(&buf); err != io.EOF {
+		t.Fatalf("expected io.EOF after the last record, got %v", err)
+	}
+}
+
+func TestSnapshotRecordTruncated(t *testing.T) {
+	var buf bytes.Buffer
+	if err := writeSnapshotRecord(&buf, "svc/default/foo", localnetv1.Set_ServicesSet, []byte("bytes")); err != nil {
+		t.Fatalf("writeSnapshotRecord: %v", err)
+	}
+
+	truncated := bytes.NewReader(buf.Bytes()[:buf.Len()-2])
+
+	if _, _, _, err := readSnapshotRecord(truncated); err == nil || err == io.EOF {
+		t.Fatalf("expected a non-EOF error on a truncated record, got %v", err)
+	}
+}
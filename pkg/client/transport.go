@@ -0,0 +1,77 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package client
+
+import (
+	"context"
+	"net"
+	"net/url"
+	"strings"
+
+	"google.golang.org/grpc"
+)
+
+// resolveTarget parses epc.Target the way etcd clientv3's NewFromURL does:
+// a bare "host:port" (or "multi:///...") is passed to gRPC unchanged, while
+// a scheme we recognize gets translated into dial options. It returns the
+// (possibly rewritten) dial target, extra dial options to apply, and
+// whether TLS should be considered enabled absent an explicit --tls flag.
+func resolveTarget(target string) (dialTarget string, opts []grpc.DialOption, tlsImplied *bool) {
+	u, err := url.Parse(target)
+	if err != nil || u.Scheme == "" {
+		// not a URL (or no scheme): hand it to gRPC as-is, e.g.
+		// "127.0.0.1:12090" or "multi:///a,b,c"
+		return target, nil, nil
+	}
+
+	switch u.Scheme {
+	case "unix", "unix-abstract":
+		path := u.Path
+		if path == "" {
+			path = u.Opaque
+		}
+		if u.Scheme == "unix-abstract" {
+			// unix-abstract://name (two slashes) puts the name in u.Host with
+			// an empty u.Path; unix-abstract:///name (three slashes) puts it
+			// in u.Path with a leading "/" that isn't part of the abstract
+			// name. Normalize both to the bare name before prefixing "@".
+			if path == "" {
+				path = u.Host
+			}
+			path = "@" + strings.TrimPrefix(path, "/")
+		}
+
+		dialer := func(ctx context.Context, _ string) (net.Conn, error) {
+			d := net.Dialer{}
+			return d.DialContext(ctx, "unix", path)
+		}
+
+		no := false
+		return "unix:" + path, []grpc.DialOption{grpc.WithContextDialer(dialer)}, &no
+
+	case "http", "https":
+		secure := u.Scheme == "https"
+		return u.Host, nil, &secure
+
+	case "passthrough", "dns", "multi":
+		// first-class schemes gRPC's own resolvers already understand
+		return target, nil, nil
+
+	default:
+		return target, nil, nil
+	}
+}
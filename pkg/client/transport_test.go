@@ -0,0 +1,117 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package client
+
+import "testing"
+
+func TestResolveTargetNoScheme(t *testing.T) {
+	dialTarget, opts, tlsImplied := resolveTarget("127.0.0.1:12090")
+
+	if dialTarget != "127.0.0.1:12090" {
+		t.Errorf("dialTarget = %q, want unchanged target", dialTarget)
+	}
+	if opts != nil {
+		t.Errorf("opts = %v, want nil", opts)
+	}
+	if tlsImplied != nil {
+		t.Errorf("tlsImplied = %v, want nil", tlsImplied)
+	}
+}
+
+func TestResolveTargetMulti(t *testing.T) {
+	target := "multi:///1.0.0.1:1234,1.0.0.2:1234"
+
+	dialTarget, opts, tlsImplied := resolveTarget(target)
+
+	if dialTarget != target {
+		t.Errorf("dialTarget = %q, want %q unchanged", dialTarget, target)
+	}
+	if opts != nil || tlsImplied != nil {
+		t.Errorf("expected multi:// to pass through to gRPC's own resolver untouched")
+	}
+}
+
+func TestResolveTargetUnixPath(t *testing.T) {
+	dialTarget, opts, tlsImplied := resolveTarget("unix:///var/run/kpng.sock")
+
+	if dialTarget != "unix:/var/run/kpng.sock" {
+		t.Errorf("dialTarget = %q, want %q", dialTarget, "unix:/var/run/kpng.sock")
+	}
+	if len(opts) != 1 {
+		t.Errorf("expected a context dialer option, got %d opts", len(opts))
+	}
+	if tlsImplied == nil || *tlsImplied {
+		t.Errorf("tlsImplied = %v, want false", tlsImplied)
+	}
+}
+
+func TestResolveTargetUnixAbstractTwoSlash(t *testing.T) {
+	// unix-abstract://name: the name lands in u.Host, not u.Path.
+	dialTarget, _, _ := resolveTarget("unix-abstract://kpng")
+
+	if dialTarget != "unix:@kpng" {
+		t.Errorf("dialTarget = %q, want %q", dialTarget, "unix:@kpng")
+	}
+}
+
+func TestResolveTargetUnixAbstractThreeSlash(t *testing.T) {
+	// unix-abstract:///name: the name lands in u.Path with a leading "/"
+	// that must be stripped, not treated as part of the abstract name.
+	dialTarget, _, _ := resolveTarget("unix-abstract:///kpng")
+
+	if dialTarget != "unix:@kpng" {
+		t.Errorf("dialTarget = %q, want %q", dialTarget, "unix:@kpng")
+	}
+}
+
+func TestResolveTargetHTTP(t *testing.T) {
+	dialTarget, opts, tlsImplied := resolveTarget("http://127.0.0.1:12090")
+
+	if dialTarget != "127.0.0.1:12090" {
+		t.Errorf("dialTarget = %q, want %q", dialTarget, "127.0.0.1:12090")
+	}
+	if opts != nil {
+		t.Errorf("opts = %v, want nil", opts)
+	}
+	if tlsImplied == nil || *tlsImplied {
+		t.Errorf("tlsImplied = %v, want false for http://", tlsImplied)
+	}
+}
+
+func TestResolveTargetHTTPS(t *testing.T) {
+	dialTarget, _, tlsImplied := resolveTarget("https://127.0.0.1:12090")
+
+	if dialTarget != "127.0.0.1:12090" {
+		t.Errorf("dialTarget = %q, want %q", dialTarget, "127.0.0.1:12090")
+	}
+	if tlsImplied == nil || !*tlsImplied {
+		t.Errorf("tlsImplied = %v, want true for https://", tlsImplied)
+	}
+}
+
+func TestResolveTargetPassthroughLikeSchemes(t *testing.T) {
+	for _, target := range []string{"passthrough:///127.0.0.1:12090", "dns:///kpng.default.svc:12090"} {
+		dialTarget, opts, tlsImplied := resolveTarget(target)
+
+		if dialTarget != target {
+			t.Errorf("resolveTarget(%q) dialTarget = %q, want unchanged", target, dialTarget)
+		}
+		if opts != nil || tlsImplied != nil {
+			t.Errorf("resolveTarget(%q) should pass through to gRPC's own resolver untouched", target)
+		}
+	}
+}